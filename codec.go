@@ -21,6 +21,29 @@ var (
 	ErrCantUnpackVersion         = errors.New("couldn't unpack codec version")
 	ErrUnknownVersion            = errors.New("unknown codec version")
 	ErrDuplicateType             = errors.New("duplicate type registration")
+	// ErrNonCanonical is returned by a canonical-enforcing Codec's
+	// UnmarshalFrom when the input isn't the unique canonical encoding of
+	// the value it decodes to.
+	ErrNonCanonical = errors.New("not the canonical encoding")
+)
+
+// CanonicalMode controls how strictly a Codec enforces that Unmarshal only
+// accepts the unique canonical encoding of a value, for consensus-critical
+// payloads where non-canonical encodings must be rejected outright.
+type CanonicalMode int
+
+const (
+	// CanonicalOff performs no canonical-encoding checks beyond a Codec's
+	// normal validation.
+	CanonicalOff CanonicalMode = iota
+	// CanonicalStrict additionally rejects trailing bytes after a
+	// successful unmarshal. It's cheap enough for production use.
+	CanonicalStrict
+	// CanonicalParanoid does everything CanonicalStrict does, and also
+	// re-marshals the decoded value and byte-compares it against the
+	// input, rejecting any mismatch. It's intended for fuzzing and tests:
+	// re-marshaling costs an extra full pass over the value.
+	CanonicalParanoid
 )
 
 // Codec marshals and unmarshals
@@ -32,12 +55,43 @@ type Codec interface {
 
 // Manager manages multiple codec versions
 type Manager interface {
-	RegisterCodec(version uint16, codec Codec) error
+	RegisterCodec(version uint16, codec Codec, opts ...RegisterOption) error
 	Marshal(version uint16, source interface{}) ([]byte, error)
 	Unmarshal(bytes []byte, dest interface{}) (uint16, error)
 	Size(version uint16, value interface{}) (int, error)
 }
 
+// VersionSetter is implemented by codecs that need to know which Manager
+// version they were registered under, e.g. to evaluate `since`/`until`
+// struct tag bounds for schema evolution. RegisterCodec calls it
+// automatically when present.
+type VersionSetter interface {
+	SetCodecVersion(version uint16)
+}
+
+// CanonicalSetter is implemented by codecs that support CanonicalMode
+// enforcement. RegisterCodec calls it automatically whenever the codec being
+// registered implements it, passing the mode given by WithCanonical, or
+// CanonicalOff when that option is absent.
+type CanonicalSetter interface {
+	SetCanonical(mode CanonicalMode)
+}
+
+// RegisterOption configures a codec registration with RegisterCodec.
+type RegisterOption func(*registerConfig)
+
+type registerConfig struct {
+	canonical CanonicalMode
+}
+
+// WithCanonical enables CanonicalMode enforcement on the codec being
+// registered, if it implements CanonicalSetter.
+func WithCanonical(mode CanonicalMode) RegisterOption {
+	return func(cfg *registerConfig) {
+		cfg.canonical = mode
+	}
+}
+
 // DefaultMaxSize is the default maximum size for codec manager (1MB)
 const DefaultMaxSize = 1024 * 1024
 
@@ -59,10 +113,20 @@ type manager struct {
 	codecs  map[uint16]Codec
 }
 
-func (m *manager) RegisterCodec(version uint16, codec Codec) error {
+func (m *manager) RegisterCodec(version uint16, codec Codec, opts ...RegisterOption) error {
 	if _, exists := m.codecs[version]; exists {
 		return ErrDuplicateType
 	}
+	var cfg registerConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if vs, ok := codec.(VersionSetter); ok {
+		vs.SetCodecVersion(version)
+	}
+	if cs, ok := codec.(CanonicalSetter); ok {
+		cs.SetCanonical(cfg.canonical)
+	}
 	m.codecs[version] = codec
 	return nil
 }
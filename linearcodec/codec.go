@@ -4,8 +4,11 @@
 package linearcodec
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"sync"
 
@@ -20,15 +23,24 @@ const (
 var (
 	ErrCantRegisterType = errors.New("can't register type")
 	ErrTypeNotFound     = errors.New("type not found")
+	// ErrBadTag is returned when a `codec:"..."` struct tag can't be parsed.
+	ErrBadTag = errors.New("bad codec tag")
+	// ErrTooManyOptionalFields is returned when a struct has more optional
+	// fields than fit in the uint32 presence bitmap.
+	ErrTooManyOptionalFields = errors.New("more than 32 optional fields in struct")
 )
 
 // Codec is a linear codec for serialization
 type Codec struct {
 	lock        sync.RWMutex
 	maxSliceLen int
+	varint      bool
+	version     uint16
+	canonical   codec.CanonicalMode
 	nextTypeID  uint32
 	typeIDToIdx map[reflect.Type]uint32
 	idxToType   map[uint32]reflect.Type
+	fieldTags   map[reflect.Type][]fieldTag
 }
 
 // New returns a new linear codec with the default max slice length
@@ -38,6 +50,7 @@ func New(maxSliceLen int) *Codec {
 		nextTypeID:  0,
 		typeIDToIdx: make(map[reflect.Type]uint32),
 		idxToType:   make(map[uint32]reflect.Type),
+		fieldTags:   make(map[reflect.Type][]fieldTag),
 	}
 }
 
@@ -46,6 +59,35 @@ func NewDefault() *Codec {
 	return New(DefaultMaxSliceLen)
 }
 
+// NewVarint returns a new linear codec that encodes unsigned integers,
+// slice lengths, and string lengths as LEB128 varints, and signed integers
+// using zig-zag encoding, instead of the fixed-width big-endian fields
+// Codec normally uses. It should be registered under its own Manager
+// version so plain and varint-encoded messages can coexist on the wire.
+func NewVarint(maxSliceLen int) *Codec {
+	c := New(maxSliceLen)
+	c.varint = true
+	return c
+}
+
+// SetCodecVersion records the Manager version this Codec is registered
+// under. codec.Manager.RegisterCodec calls this automatically if the Codec
+// being registered implements it. The version is used to evaluate `since`
+// and `until` struct tag bounds when marshaling and unmarshaling.
+func (c *Codec) SetCodecVersion(version uint16) {
+	c.lock.Lock()
+	c.version = version
+	c.lock.Unlock()
+}
+
+// SetCanonical enables or disables canonical-encoding enforcement on
+// UnmarshalFrom. See codec.CanonicalMode.
+func (c *Codec) SetCanonical(mode codec.CanonicalMode) {
+	c.lock.Lock()
+	c.canonical = mode
+	c.lock.Unlock()
+}
+
 // SkipRegistrations skips the next n type IDs (for backwards compatibility)
 func (c *Codec) SkipRegistrations(num int) {
 	c.lock.Lock()
@@ -75,13 +117,72 @@ func (c *Codec) MarshalInto(val interface{}, p *codec.Packer) error {
 	return c.marshal(reflect.ValueOf(val), p)
 }
 
-// UnmarshalFrom unmarshals from the packer into the value
+// UnmarshalFrom unmarshals from the packer into the value. Slice lengths
+// are bounds-checked against maxSliceLen inline during traversal,
+// regardless of canonical mode, so a malicious length can never reach
+// reflect.MakeSlice. If canonical encoding enforcement is additionally
+// enabled via SetCanonical, it returns codec.ErrNonCanonical when bytes
+// remain in p after the value; under codec.CanonicalParanoid it also
+// re-marshals the decoded value and returns codec.ErrNonCanonical unless
+// that matches the consumed input byte for byte.
 func (c *Codec) UnmarshalFrom(p *codec.Packer, val interface{}) error {
 	rv := reflect.ValueOf(val)
 	if rv.Kind() != reflect.Ptr {
 		return fmt.Errorf("%w: need pointer to unmarshal", codec.ErrUnsupportedType)
 	}
-	return c.unmarshal(p, rv.Elem())
+
+	start := p.Offset
+	if err := c.unmarshal(p, rv.Elem()); err != nil {
+		return err
+	}
+
+	if c.canonical == codec.CanonicalOff {
+		return nil
+	}
+	if p.Remaining() != 0 {
+		return codec.ErrNonCanonical
+	}
+	if c.canonical == codec.CanonicalParanoid {
+		input := p.Bytes[start:p.Offset]
+		reenc := codec.NewPacker(len(input))
+		if err := c.marshal(rv.Elem(), reenc); err != nil {
+			return err
+		}
+		if reenc.Err != nil {
+			return reenc.Err
+		}
+		if !bytes.Equal(reenc.Bytes[:reenc.Offset], input) {
+			return codec.ErrNonCanonical
+		}
+	}
+	return nil
+}
+
+// MarshalStream marshals the value directly onto w, emitting each slice,
+// array and struct field as it's visited rather than building the whole
+// serialized form in memory first. This lets large (multi-MB) values be
+// produced without a full-size intermediate buffer.
+func (c *Codec) MarshalStream(val interface{}, w io.Writer) error {
+	e := codec.NewEncoder(w)
+	if err := c.marshal(reflect.ValueOf(val), e); err != nil {
+		return err
+	}
+	return e.Err
+}
+
+// UnmarshalStream unmarshals from r into val, reading incrementally instead
+// of requiring the full serialized form to be buffered up front. opts can
+// be used to bound the total number of bytes read, e.g. codec.MaxSize.
+func (c *Codec) UnmarshalStream(r io.Reader, val interface{}, opts ...codec.DecoderOption) error {
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Ptr {
+		return fmt.Errorf("%w: need pointer to unmarshal", codec.ErrUnsupportedType)
+	}
+	d := codec.NewDecoder(r, opts...)
+	if err := c.unmarshal(d, rv.Elem()); err != nil {
+		return err
+	}
+	return d.Err
 }
 
 // Size returns the serialized size of the value
@@ -89,9 +190,9 @@ func (c *Codec) Size(val interface{}) (int, error) {
 	return c.size(reflect.ValueOf(val))
 }
 
-func (c *Codec) marshal(rv reflect.Value, p *codec.Packer) error {
+func (c *Codec) marshal(rv reflect.Value, p codec.Sink) error {
 	if p.Errored() {
-		return p.Err
+		return p.Error()
 	}
 
 	switch rv.Kind() {
@@ -100,30 +201,54 @@ func (c *Codec) marshal(rv reflect.Value, p *codec.Packer) error {
 	case reflect.Uint8:
 		p.PackByte(byte(rv.Uint()))
 	case reflect.Uint16:
-		p.PackShort(uint16(rv.Uint()))
+		if c.varint {
+			p.PackUvarint(rv.Uint())
+		} else {
+			p.PackShort(uint16(rv.Uint()))
+		}
 	case reflect.Uint32:
-		p.PackInt(uint32(rv.Uint()))
+		if c.varint {
+			p.PackUvarint(rv.Uint())
+		} else {
+			p.PackInt(uint32(rv.Uint()))
+		}
 	case reflect.Uint64:
-		p.PackLong(rv.Uint())
+		if c.varint {
+			p.PackUvarint(rv.Uint())
+		} else {
+			p.PackLong(rv.Uint())
+		}
 	case reflect.Int8:
 		p.PackByte(byte(rv.Int()))
 	case reflect.Int16:
-		p.PackShort(uint16(rv.Int()))
+		if c.varint {
+			p.PackVarint(rv.Int())
+		} else {
+			p.PackShort(uint16(rv.Int()))
+		}
 	case reflect.Int32:
-		p.PackInt(uint32(rv.Int()))
+		if c.varint {
+			p.PackVarint(rv.Int())
+		} else {
+			p.PackInt(uint32(rv.Int()))
+		}
 	case reflect.Int64:
-		p.PackLong(uint64(rv.Int()))
+		if c.varint {
+			p.PackVarint(rv.Int())
+		} else {
+			p.PackLong(uint64(rv.Int()))
+		}
 	case reflect.String:
-		p.PackStr(rv.String())
+		c.packStr(p, rv.String())
 	case reflect.Slice:
 		if rv.IsNil() {
-			p.PackInt(0)
-			return p.Err
+			c.packLen(p, 0)
+			return p.Error()
 		}
 		if rv.Len() > c.maxSliceLen {
 			return codec.ErrMaxSliceLenExceeded
 		}
-		p.PackInt(uint32(rv.Len()))
+		c.packLen(p, rv.Len())
 		for i := 0; i < rv.Len(); i++ {
 			if err := c.marshal(rv.Index(i), p); err != nil {
 				return err
@@ -136,11 +261,7 @@ func (c *Codec) marshal(rv reflect.Value, p *codec.Packer) error {
 			}
 		}
 	case reflect.Struct:
-		for i := 0; i < rv.NumField(); i++ {
-			if err := c.marshal(rv.Field(i), p); err != nil {
-				return err
-			}
-		}
+		return c.marshalStruct(rv, p)
 	case reflect.Ptr:
 		if rv.IsNil() {
 			return codec.ErrMarshalZeroLength
@@ -161,12 +282,12 @@ func (c *Codec) marshal(rv reflect.Value, p *codec.Packer) error {
 	default:
 		return fmt.Errorf("%w: %v", codec.ErrUnsupportedType, rv.Kind())
 	}
-	return p.Err
+	return p.Error()
 }
 
-func (c *Codec) unmarshal(p *codec.Packer, rv reflect.Value) error {
+func (c *Codec) unmarshal(p codec.Source, rv reflect.Value) error {
 	if p.Errored() {
-		return p.Err
+		return p.Error()
 	}
 
 	switch rv.Kind() {
@@ -175,25 +296,49 @@ func (c *Codec) unmarshal(p *codec.Packer, rv reflect.Value) error {
 	case reflect.Uint8:
 		rv.SetUint(uint64(p.UnpackByte()))
 	case reflect.Uint16:
-		rv.SetUint(uint64(p.UnpackShort()))
+		if c.varint {
+			rv.SetUint(p.UnpackUvarint())
+		} else {
+			rv.SetUint(uint64(p.UnpackShort()))
+		}
 	case reflect.Uint32:
-		rv.SetUint(uint64(p.UnpackInt()))
+		if c.varint {
+			rv.SetUint(p.UnpackUvarint())
+		} else {
+			rv.SetUint(uint64(p.UnpackInt()))
+		}
 	case reflect.Uint64:
-		rv.SetUint(p.UnpackLong())
+		if c.varint {
+			rv.SetUint(p.UnpackUvarint())
+		} else {
+			rv.SetUint(p.UnpackLong())
+		}
 	case reflect.Int8:
 		rv.SetInt(int64(p.UnpackByte()))
 	case reflect.Int16:
-		rv.SetInt(int64(p.UnpackShort()))
+		if c.varint {
+			rv.SetInt(p.UnpackVarint())
+		} else {
+			rv.SetInt(int64(p.UnpackShort()))
+		}
 	case reflect.Int32:
-		rv.SetInt(int64(p.UnpackInt()))
+		if c.varint {
+			rv.SetInt(p.UnpackVarint())
+		} else {
+			rv.SetInt(int64(p.UnpackInt()))
+		}
 	case reflect.Int64:
-		rv.SetInt(int64(p.UnpackLong()))
+		if c.varint {
+			rv.SetInt(p.UnpackVarint())
+		} else {
+			rv.SetInt(int64(p.UnpackLong()))
+		}
 	case reflect.String:
-		rv.SetString(p.UnpackStr())
+		rv.SetString(c.unpackStr(p))
 	case reflect.Slice:
-		length := int(p.UnpackInt())
-		if length > c.maxSliceLen {
-			return codec.ErrMaxSliceLenExceeded
+		length, err := c.unpackLen(p)
+		if err != nil {
+			return err
 		}
 		slice := reflect.MakeSlice(rv.Type(), length, length)
 		for i := 0; i < length; i++ {
@@ -209,11 +354,7 @@ func (c *Codec) unmarshal(p *codec.Packer, rv reflect.Value) error {
 			}
 		}
 	case reflect.Struct:
-		for i := 0; i < rv.NumField(); i++ {
-			if err := c.unmarshal(p, rv.Field(i)); err != nil {
-				return err
-			}
-		}
+		return c.unmarshalStruct(p, rv)
 	case reflect.Ptr:
 		elem := reflect.New(rv.Type().Elem())
 		if err := c.unmarshal(p, elem.Elem()); err != nil {
@@ -237,26 +378,123 @@ func (c *Codec) unmarshal(p *codec.Packer, rv reflect.Value) error {
 	default:
 		return fmt.Errorf("%w: %v", codec.ErrUnsupportedType, rv.Kind())
 	}
-	return p.Err
+	return p.Error()
+}
+
+// packLen packs a slice length, as a varint when c.varint is set or as a
+// fixed uint32 otherwise.
+func (c *Codec) packLen(p codec.Sink, n int) {
+	if c.varint {
+		p.PackUvarint(uint64(n))
+	} else {
+		p.PackInt(uint32(n))
+	}
+}
+
+// unpackLen unpacks a slice length packed by packLen, rejecting it outright
+// if it exceeds maxSliceLen. The check is done in uint64 before any
+// conversion to int: a varint can encode values up to 2^64-1, and a naive
+// int(...) conversion of a value >= 2^63 wraps around to a negative int,
+// which would slip past a plain `length > c.maxSliceLen` comparison and
+// panic reflect.MakeSlice. Enforcing the bound here, at decode time, means
+// every caller gets it for free.
+func (c *Codec) unpackLen(p codec.Source) (int, error) {
+	var n uint64
+	if c.varint {
+		n = p.UnpackUvarint()
+	} else {
+		n = uint64(p.UnpackInt())
+	}
+	if err := p.Error(); err != nil {
+		return 0, err
+	}
+	if n > uint64(c.maxSliceLen) {
+		return 0, codec.ErrMaxSliceLenExceeded
+	}
+	return int(n), nil
+}
+
+// packStr packs a string, with its length as a varint when c.varint is set
+// or as codec.Packer's fixed uint16 length prefix otherwise.
+func (c *Codec) packStr(p codec.Sink, s string) {
+	if c.varint {
+		p.PackUvarint(uint64(len(s)))
+		p.PackFixedBytes([]byte(s))
+		return
+	}
+	p.PackStr(s)
+}
+
+// unpackStr unpacks a string packed by packStr.
+func (c *Codec) unpackStr(p codec.Source) string {
+	if c.varint {
+		return string(p.UnpackFixedBytes(int(p.UnpackUvarint())))
+	}
+	return p.UnpackStr()
+}
+
+// uvarintSize returns the number of bytes the canonical LEB128 encoding of
+// val occupies.
+func uvarintSize(val uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], val)
+}
+
+// zigZag converts a signed integer to its zig-zag encoded unsigned form.
+func zigZag(val int64) uint64 {
+	return uint64(val<<1) ^ uint64(val>>63)
 }
 
 func (c *Codec) size(rv reflect.Value) (int, error) {
 	switch rv.Kind() {
 	case reflect.Bool, reflect.Uint8, reflect.Int8:
 		return 1, nil
-	case reflect.Uint16, reflect.Int16:
+	case reflect.Uint16:
+		if c.varint {
+			return uvarintSize(rv.Uint()), nil
+		}
 		return 2, nil
-	case reflect.Uint32, reflect.Int32:
+	case reflect.Int16:
+		if c.varint {
+			return uvarintSize(zigZag(rv.Int())), nil
+		}
+		return 2, nil
+	case reflect.Uint32:
+		if c.varint {
+			return uvarintSize(rv.Uint()), nil
+		}
+		return 4, nil
+	case reflect.Int32:
+		if c.varint {
+			return uvarintSize(zigZag(rv.Int())), nil
+		}
 		return 4, nil
-	case reflect.Uint64, reflect.Int64:
+	case reflect.Uint64:
+		if c.varint {
+			return uvarintSize(rv.Uint()), nil
+		}
+		return 8, nil
+	case reflect.Int64:
+		if c.varint {
+			return uvarintSize(zigZag(rv.Int())), nil
+		}
 		return 8, nil
 	case reflect.String:
+		if c.varint {
+			return uvarintSize(uint64(len(rv.String()))) + len(rv.String()), nil
+		}
 		return 2 + len(rv.String()), nil
 	case reflect.Slice:
 		if rv.IsNil() {
+			if c.varint {
+				return uvarintSize(0), nil
+			}
 			return 4, nil
 		}
 		size := 4
+		if c.varint {
+			size = uvarintSize(uint64(rv.Len()))
+		}
 		for i := 0; i < rv.Len(); i++ {
 			s, err := c.size(rv.Index(i))
 			if err != nil {
@@ -276,15 +514,7 @@ func (c *Codec) size(rv reflect.Value) (int, error) {
 		}
 		return size, nil
 	case reflect.Struct:
-		size := 0
-		for i := 0; i < rv.NumField(); i++ {
-			s, err := c.size(rv.Field(i))
-			if err != nil {
-				return 0, err
-			}
-			size += s
-		}
-		return size, nil
+		return c.sizeStruct(rv)
 	case reflect.Ptr:
 		if rv.IsNil() {
 			return 0, codec.ErrMarshalZeroLength
@@ -0,0 +1,265 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package linearcodec
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/luxfi/codec"
+)
+
+// fieldTag is the parsed form of a `codec:"..."` struct tag.
+type fieldTag struct {
+	// tagged is true if a `codec:"..."` tag was present at all, whether or
+	// not it carried any recognized attributes.
+	tagged bool
+	// skip is true for `codec:"-"`: the field is never read or written.
+	skip bool
+	// omitEmpty marks the field present in the optional bitmap only when
+	// it holds a non-zero value.
+	omitEmpty bool
+	// optional marks the field as participating in the optional bitmap
+	// unconditionally (subject to since/until bounds).
+	optional bool
+	// hasSince/since and hasUntil/until bound the Manager versions this
+	// field exists in; a field outside its bounds is skipped entirely.
+	hasSince bool
+	since    uint16
+	hasUntil bool
+	until    uint16
+}
+
+// optionalInBitmap reports whether this field participates in its struct's
+// leading presence bitmap rather than always being serialized in order.
+func (t fieldTag) optionalInBitmap() bool {
+	return t.optional || t.omitEmpty
+}
+
+// existsAt reports whether this field is part of the schema at codec
+// version, per its since/until bounds. A field outside its bounds doesn't
+// exist on the wire for that version at all: it's never read or written,
+// and is left at its zero value.
+func (t fieldTag) existsAt(version uint16) bool {
+	if t.hasSince && version < t.since {
+		return false
+	}
+	if t.hasUntil && version > t.until {
+		return false
+	}
+	return true
+}
+
+// present reports whether rv should be marshaled given this tag. It only
+// has an opinion for omitempty fields; optional-without-omitempty fields
+// are always present once they're in scope for the current version.
+func (t fieldTag) present(rv reflect.Value) bool {
+	if t.omitEmpty {
+		return !rv.IsZero()
+	}
+	return true
+}
+
+// parseFieldTag parses the `codec:"..."` tag on sf, if any. A missing tag
+// yields a zero-value fieldTag with tagged == false.
+func parseFieldTag(sf reflect.StructField) (fieldTag, error) {
+	raw, ok := sf.Tag.Lookup("codec")
+	if !ok {
+		return fieldTag{}, nil
+	}
+	ft := fieldTag{tagged: true}
+	if raw == "-" {
+		ft.skip = true
+		return ft, nil
+	}
+
+	for _, attr := range strings.Split(raw, ",") {
+		switch {
+		case attr == "" || attr == "-":
+			// ignore stray separators
+		case attr == "omitempty":
+			ft.omitEmpty = true
+		case attr == "optional":
+			ft.optional = true
+		case strings.HasPrefix(attr, "since="):
+			v, err := strconv.ParseUint(attr[len("since="):], 10, 16)
+			if err != nil {
+				return fieldTag{}, fmt.Errorf("%w: %s: bad since in tag %q", ErrBadTag, sf.Name, raw)
+			}
+			ft.hasSince = true
+			ft.since = uint16(v)
+		case strings.HasPrefix(attr, "until="):
+			v, err := strconv.ParseUint(attr[len("until="):], 10, 16)
+			if err != nil {
+				return fieldTag{}, fmt.Errorf("%w: %s: bad until in tag %q", ErrBadTag, sf.Name, raw)
+			}
+			ft.hasUntil = true
+			ft.until = uint16(v)
+		default:
+			return fieldTag{}, fmt.Errorf("%w: %s: unknown attribute %q in tag %q", ErrBadTag, sf.Name, attr, raw)
+		}
+	}
+	return ft, nil
+}
+
+// structFieldTags returns the parsed `codec` tags for t's fields, one per
+// field in declaration order, parsing and caching them on first use.
+func (c *Codec) structFieldTags(t reflect.Type) ([]fieldTag, error) {
+	c.lock.RLock()
+	tags, ok := c.fieldTags[t]
+	c.lock.RUnlock()
+	if ok {
+		return tags, nil
+	}
+
+	tags = make([]fieldTag, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		ft, err := parseFieldTag(sf)
+		if err != nil {
+			return nil, err
+		}
+		if ft.tagged && sf.PkgPath != "" {
+			return nil, fmt.Errorf("%w: %s.%s", codec.ErrUnexportedField, t.Name(), sf.Name)
+		}
+		tags[i] = ft
+	}
+
+	c.lock.Lock()
+	c.fieldTags[t] = tags
+	c.lock.Unlock()
+	return tags, nil
+}
+
+// marshalStruct marshals rv's fields in order. If any field exists at this
+// Codec's version and is optional (tagged `optional` or `omitempty`), a
+// leading uint32 bitmap is emitted first, one bit per optional field in
+// declaration order, and absent fields are skipped rather than written.
+func (c *Codec) marshalStruct(rv reflect.Value, p codec.Sink) error {
+	t := rv.Type()
+	tags, err := c.structFieldTags(t)
+	if err != nil {
+		return err
+	}
+
+	var bitmap uint32
+	bit := uint(0)
+	for i := 0; i < t.NumField(); i++ {
+		ft := tags[i]
+		if ft.skip || !ft.existsAt(c.version) || !ft.optionalInBitmap() {
+			continue
+		}
+		if bit >= 32 {
+			return ErrTooManyOptionalFields
+		}
+		if ft.present(rv.Field(i)) {
+			bitmap |= 1 << bit
+		}
+		bit++
+	}
+	if bit > 0 {
+		p.PackInt(bitmap)
+	}
+
+	bit = 0
+	for i := 0; i < t.NumField(); i++ {
+		ft := tags[i]
+		if ft.skip || !ft.existsAt(c.version) {
+			continue
+		}
+		if ft.optionalInBitmap() {
+			present := bitmap&(1<<bit) != 0
+			bit++
+			if !present {
+				continue
+			}
+		}
+		if err := c.marshal(rv.Field(i), p); err != nil {
+			return err
+		}
+	}
+	return p.Error()
+}
+
+// unmarshalStruct is the counterpart to marshalStruct: it reads the
+// optional-field bitmap (if any fields are optional at this version) and
+// leaves absent fields at their zero value.
+func (c *Codec) unmarshalStruct(p codec.Source, rv reflect.Value) error {
+	t := rv.Type()
+	tags, err := c.structFieldTags(t)
+	if err != nil {
+		return err
+	}
+
+	hasOptional := false
+	for i := 0; i < t.NumField(); i++ {
+		ft := tags[i]
+		if !ft.skip && ft.existsAt(c.version) && ft.optionalInBitmap() {
+			hasOptional = true
+			break
+		}
+	}
+
+	var bitmap uint32
+	if hasOptional {
+		bitmap = p.UnpackInt()
+	}
+
+	bit := uint(0)
+	for i := 0; i < t.NumField(); i++ {
+		ft := tags[i]
+		if ft.skip || !ft.existsAt(c.version) {
+			continue
+		}
+		if ft.optionalInBitmap() {
+			if bit >= 32 {
+				return ErrTooManyOptionalFields
+			}
+			present := bitmap&(1<<bit) != 0
+			bit++
+			if !present {
+				continue
+			}
+		}
+		if err := c.unmarshal(p, rv.Field(i)); err != nil {
+			return err
+		}
+	}
+	return p.Error()
+}
+
+// sizeStruct mirrors marshalStruct's wire layout.
+func (c *Codec) sizeStruct(rv reflect.Value) (int, error) {
+	t := rv.Type()
+	tags, err := c.structFieldTags(t)
+	if err != nil {
+		return 0, err
+	}
+
+	size := 0
+	hasOptional := false
+	for i := 0; i < t.NumField(); i++ {
+		ft := tags[i]
+		if ft.skip || !ft.existsAt(c.version) {
+			continue
+		}
+		if ft.optionalInBitmap() {
+			hasOptional = true
+			if !ft.present(rv.Field(i)) {
+				continue
+			}
+		}
+		s, err := c.size(rv.Field(i))
+		if err != nil {
+			return 0, err
+		}
+		size += s
+	}
+	if hasOptional {
+		size += codec.IntLen
+	}
+	return size, nil
+}
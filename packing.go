@@ -62,6 +62,11 @@ func (p *Packer) Errored() bool {
 	return p.Err != nil
 }
 
+// Error returns the first error encountered, if any.
+func (p *Packer) Error() error {
+	return p.Err
+}
+
 // expand ensures capacity for n more bytes
 func (p *Packer) expand(n int) {
 	if p.Err != nil {
@@ -175,6 +180,76 @@ func (p *Packer) UnpackLong() uint64 {
 	return val
 }
 
+// maxVarintLen is the longest an unsigned LEB128 varint can be when
+// encoding a uint64: ceil(64/7) == 10 bytes.
+const maxVarintLen = binary.MaxVarintLen64
+
+// PackUvarint packs val as an unsigned LEB128 varint: 7 data bits per byte,
+// with the high bit of each byte set to 1 if more bytes follow.
+func (p *Packer) PackUvarint(val uint64) {
+	var buf [maxVarintLen]byte
+	n := binary.PutUvarint(buf[:], val)
+	p.PackFixedBytes(buf[:n])
+}
+
+// UnpackUvarint unpacks an unsigned LEB128 varint. It rejects varints
+// longer than 10 bytes and non-canonical (overlong) encodings, i.e. ones
+// using more bytes than the minimal encoding of the decoded value.
+func (p *Packer) UnpackUvarint() uint64 {
+	if p.Err != nil {
+		return 0
+	}
+	var val uint64
+	var shift uint
+	for n := 0; ; n++ {
+		if n >= maxVarintLen {
+			p.Err = ErrOverflow
+			return 0
+		}
+		b := p.UnpackByte()
+		if p.Err != nil {
+			return 0
+		}
+		if n == maxVarintLen-1 && b > 1 {
+			// The 10th byte can only ever contribute bit 63 of val: shifting
+			// a 7-bit byte left by 63 silently discards bits 1-6, so a
+			// larger byte here would decode without error into the wrong,
+			// truncated value instead of the overlong/overflowing varint it
+			// actually encodes.
+			p.Err = ErrOverflow
+			return 0
+		}
+		val |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			if uvarintLen(val) != n+1 {
+				p.Err = ErrBadLength
+				return 0
+			}
+			return val
+		}
+		shift += 7
+	}
+}
+
+// uvarintLen returns the number of bytes the canonical LEB128 encoding of
+// val occupies.
+func uvarintLen(val uint64) int {
+	var buf [maxVarintLen]byte
+	return binary.PutUvarint(buf[:], val)
+}
+
+// PackVarint packs a signed integer using zig-zag encoding, (n<<1)^(n>>63),
+// followed by an unsigned LEB128 varint.
+func (p *Packer) PackVarint(val int64) {
+	p.PackUvarint(uint64(val<<1) ^ uint64(val>>63))
+}
+
+// UnpackVarint unpacks a zig-zag encoded signed varint.
+func (p *Packer) UnpackVarint() int64 {
+	uval := p.UnpackUvarint()
+	return int64(uval>>1) ^ -int64(uval&1)
+}
+
 // PackBool packs a bool
 func (p *Packer) PackBool(val bool) {
 	if val {
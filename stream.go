@@ -0,0 +1,348 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/luxfi/ids"
+)
+
+// Sink is implemented by anything that can receive packed primitive values,
+// whether buffered in memory (*Packer) or streamed incrementally (*Encoder).
+type Sink interface {
+	PackBool(val bool)
+	PackByte(val byte)
+	PackShort(val uint16)
+	PackInt(val uint32)
+	PackLong(val uint64)
+	PackStr(val string)
+	PackBytes(val []byte)
+	PackFixedBytes(val []byte)
+	PackID(id ids.ID)
+	PackUvarint(val uint64)
+	PackVarint(val int64)
+	Errored() bool
+	Error() error
+}
+
+// Source is implemented by anything that can produce packed primitive
+// values, whether buffered in memory (*Packer) or streamed incrementally
+// (*Decoder).
+type Source interface {
+	UnpackBool() bool
+	UnpackByte() byte
+	UnpackShort() uint16
+	UnpackInt() uint32
+	UnpackLong() uint64
+	UnpackStr() string
+	UnpackBytes() []byte
+	UnpackFixedBytes(n int) []byte
+	UnpackID() ids.ID
+	UnpackUvarint() uint64
+	UnpackVarint() int64
+	Errored() bool
+	Error() error
+}
+
+// Encoder packs values directly onto an io.Writer, a few bytes at a time,
+// instead of building up the entire serialized form in memory like Packer
+// does. This lets callers produce multi-MB messages without holding the
+// whole encoding in a single []byte.
+type Encoder struct {
+	w   io.Writer
+	buf [8]byte
+	Err error
+}
+
+// NewEncoder returns a new Encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Errored returns true if there's been an error.
+func (e *Encoder) Errored() bool {
+	return e.Err != nil
+}
+
+// Error returns the first error encountered, if any.
+func (e *Encoder) Error() error {
+	return e.Err
+}
+
+func (e *Encoder) write(b []byte) {
+	if e.Err != nil {
+		return
+	}
+	if _, err := e.w.Write(b); err != nil {
+		e.Err = err
+	}
+}
+
+// PackByte packs a byte.
+func (e *Encoder) PackByte(val byte) {
+	e.buf[0] = val
+	e.write(e.buf[:1])
+}
+
+// PackBool packs a bool.
+func (e *Encoder) PackBool(val bool) {
+	if val {
+		e.PackByte(1)
+	} else {
+		e.PackByte(0)
+	}
+}
+
+// PackShort packs a uint16.
+func (e *Encoder) PackShort(val uint16) {
+	binary.BigEndian.PutUint16(e.buf[:2], val)
+	e.write(e.buf[:2])
+}
+
+// PackInt packs a uint32.
+func (e *Encoder) PackInt(val uint32) {
+	binary.BigEndian.PutUint32(e.buf[:4], val)
+	e.write(e.buf[:4])
+}
+
+// PackLong packs a uint64.
+func (e *Encoder) PackLong(val uint64) {
+	binary.BigEndian.PutUint64(e.buf[:8], val)
+	e.write(e.buf[:8])
+}
+
+// PackFixedBytes packs a fixed-length byte slice.
+func (e *Encoder) PackFixedBytes(val []byte) {
+	e.write(val)
+}
+
+// PackBytes packs a byte slice with length prefix.
+func (e *Encoder) PackBytes(val []byte) {
+	if len(val) > math.MaxInt32 {
+		e.Err = ErrOverflow
+		return
+	}
+	e.PackInt(uint32(len(val)))
+	e.PackFixedBytes(val)
+}
+
+// PackStr packs a string with length prefix.
+func (e *Encoder) PackStr(val string) {
+	if len(val) > MaxStringLen {
+		e.Err = ErrBadLength
+		return
+	}
+	e.PackShort(uint16(len(val)))
+	e.PackFixedBytes([]byte(val))
+}
+
+// PackID packs an ID.
+func (e *Encoder) PackID(id ids.ID) {
+	e.PackFixedBytes(id[:])
+}
+
+// PackUvarint packs val as an unsigned LEB128 varint.
+func (e *Encoder) PackUvarint(val uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], val)
+	e.write(buf[:n])
+}
+
+// PackVarint packs a signed integer using zig-zag encoding followed by an
+// unsigned LEB128 varint.
+func (e *Encoder) PackVarint(val int64) {
+	e.PackUvarint(uint64(val<<1) ^ uint64(val>>63))
+}
+
+// Decoder unpacks values directly off an io.Reader, a few bytes at a time,
+// instead of requiring the entire serialized form to be buffered up front
+// like Packer does.
+type Decoder struct {
+	r       io.Reader
+	buf     [8]byte
+	maxSize int
+	read    int
+	Err     error
+}
+
+// DecoderOption configures a Decoder.
+type DecoderOption func(*Decoder)
+
+// MaxSize caps the total number of bytes a Decoder will read, returning
+// ErrOverflow once exceeded. This guards against malicious or malformed
+// streams that claim unbounded lengths.
+func MaxSize(n int) DecoderOption {
+	return func(d *Decoder) {
+		d.maxSize = n
+	}
+}
+
+// NewDecoder returns a new Decoder that reads from r. By default it is
+// capped at DefaultMaxSize bytes; pass MaxSize to override.
+func NewDecoder(r io.Reader, opts ...DecoderOption) *Decoder {
+	d := &Decoder{
+		r:       r,
+		maxSize: DefaultMaxSize,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Errored returns true if there's been an error.
+func (d *Decoder) Errored() bool {
+	return d.Err != nil
+}
+
+// Error returns the first error encountered, if any.
+func (d *Decoder) Error() error {
+	return d.Err
+}
+
+func (d *Decoder) readN(n int) []byte {
+	if d.Err != nil {
+		return nil
+	}
+	if n > d.maxSize-d.read {
+		d.Err = ErrOverflow
+		return nil
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			d.Err = ErrInsufficientLength
+		} else {
+			d.Err = err
+		}
+		return nil
+	}
+	d.read += n
+	return buf
+}
+
+// UnpackByte unpacks a byte.
+func (d *Decoder) UnpackByte() byte {
+	b := d.readN(1)
+	if d.Err != nil {
+		return 0
+	}
+	return b[0]
+}
+
+// UnpackBool unpacks a bool.
+func (d *Decoder) UnpackBool() bool {
+	return d.UnpackByte() != 0
+}
+
+// UnpackShort unpacks a uint16.
+func (d *Decoder) UnpackShort() uint16 {
+	b := d.readN(2)
+	if d.Err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+// UnpackInt unpacks a uint32.
+func (d *Decoder) UnpackInt() uint32 {
+	b := d.readN(4)
+	if d.Err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+// UnpackLong unpacks a uint64.
+func (d *Decoder) UnpackLong() uint64 {
+	b := d.readN(8)
+	if d.Err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// UnpackFixedBytes unpacks a fixed-length byte slice.
+func (d *Decoder) UnpackFixedBytes(n int) []byte {
+	if n < 0 {
+		d.Err = ErrNegativeLength
+		return nil
+	}
+	return d.readN(n)
+}
+
+// UnpackBytes unpacks a byte slice with length prefix.
+func (d *Decoder) UnpackBytes() []byte {
+	length := d.UnpackInt()
+	return d.UnpackFixedBytes(int(length))
+}
+
+// UnpackStr unpacks a string with length prefix.
+func (d *Decoder) UnpackStr() string {
+	strLen := d.UnpackShort()
+	return string(d.UnpackFixedBytes(int(strLen)))
+}
+
+// UnpackID unpacks an ID.
+func (d *Decoder) UnpackID() ids.ID {
+	bytes := d.UnpackFixedBytes(ids.IDLen)
+	if d.Err != nil {
+		return ids.Empty
+	}
+	id, err := ids.ToID(bytes)
+	if err != nil {
+		d.Err = err
+		return ids.Empty
+	}
+	return id
+}
+
+// UnpackUvarint unpacks an unsigned LEB128 varint. It rejects varints
+// longer than 10 bytes and non-canonical (overlong) encodings.
+func (d *Decoder) UnpackUvarint() uint64 {
+	if d.Err != nil {
+		return 0
+	}
+	var val uint64
+	var shift uint
+	for n := 0; ; n++ {
+		if n >= binary.MaxVarintLen64 {
+			d.Err = ErrOverflow
+			return 0
+		}
+		b := d.UnpackByte()
+		if d.Err != nil {
+			return 0
+		}
+		if n == binary.MaxVarintLen64-1 && b > 1 {
+			// The 10th byte can only ever contribute bit 63 of val: shifting
+			// a 7-bit byte left by 63 silently discards bits 1-6, so a
+			// larger byte here would decode without error into the wrong,
+			// truncated value instead of the overlong/overflowing varint it
+			// actually encodes.
+			d.Err = ErrOverflow
+			return 0
+		}
+		val |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			var buf [binary.MaxVarintLen64]byte
+			if binary.PutUvarint(buf[:], val) != n+1 {
+				d.Err = ErrBadLength
+				return 0
+			}
+			return val
+		}
+		shift += 7
+	}
+}
+
+// UnpackVarint unpacks a zig-zag encoded signed varint.
+func (d *Decoder) UnpackVarint() int64 {
+	uval := d.UnpackUvarint()
+	return int64(uval>>1) ^ -int64(uval&1)
+}